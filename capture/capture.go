@@ -0,0 +1,91 @@
+// Package capture provides the packet-capture engines RAWInput uses to
+// read real TCP traffic off the wire before handing it to a protocol
+// reassembler.
+package capture
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/pcap"
+)
+
+// EngineType selects which underlying packet source a Listener uses.
+type EngineType int
+
+const (
+	// EnginePcap captures packets with libpcap, the only engine
+	// currently supported.
+	EnginePcap EngineType = iota
+)
+
+// Handler receives the TCP payload captured between srcAddr and dstAddr
+// (each a "host:port" string). It is called once per captured segment,
+// in the order segments were seen on the wire; coalescing adjacent
+// segments into logical messages is the caller's job.
+type Handler func(srcAddr, dstAddr string, payload []byte)
+
+// Listener captures the TCP traffic to/from address using engine and
+// feeds every payload-bearing segment it sees to a Handler.
+type Listener struct {
+	address string
+	engine  EngineType
+
+	handle *pcap.Handle
+}
+
+// NewListener returns a Listener for address. Listen must be called to
+// actually start capturing.
+func NewListener(address string, engine EngineType) *Listener {
+	return &Listener{address: address, engine: engine}
+}
+
+// Listen opens the capture engine and blocks, calling handler once per
+// TCP segment carrying a nonzero payload to or from address, until
+// Close is called or the capture device errors out.
+func (l *Listener) Listen(handler Handler) error {
+	if l.engine != EnginePcap {
+		return fmt.Errorf("capture: unsupported engine %d", l.engine)
+	}
+
+	host, port, err := net.SplitHostPort(l.address)
+	if err != nil {
+		return fmt.Errorf("capture: %w", err)
+	}
+
+	device, err := findDevice(host)
+	if err != nil {
+		return err
+	}
+
+	handle, err := pcap.OpenLive(device, 65536, true, pcap.BlockForever)
+	if err != nil {
+		return fmt.Errorf("capture: opening %s: %w", device, err)
+	}
+	l.handle = handle
+	defer handle.Close()
+
+	if err := handle.SetBPFFilter("tcp and port " + port); err != nil {
+		return fmt.Errorf("capture: setting filter: %w", err)
+	}
+
+	source := gopacket.NewPacketSource(handle, handle.LinkType())
+	for packet := range source.Packets() {
+		srcAddr, dstAddr, payload, ok := parseTCPPacket(packet)
+		if !ok {
+			continue
+		}
+		handler(srcAddr, dstAddr, payload)
+	}
+	return nil
+}
+
+// Close stops a blocked Listen call by closing the underlying capture
+// handle.
+func (l *Listener) Close() error {
+	if l.handle != nil {
+		l.handle.Close()
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package capture
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/google/gopacket"
+	"github.com/google/gopacket/layers"
+	"github.com/google/gopacket/pcap"
+)
+
+// findDevice returns the name of the pcap-visible interface that owns
+// host, falling back to "lo"/"lo0" for loopback addresses since those
+// rarely show up in a literal interface-address match.
+func findDevice(host string) (string, error) {
+	ip := net.ParseIP(host)
+	if ip != nil && ip.IsLoopback() {
+		if dev, err := loopbackDevice(); err == nil {
+			return dev, nil
+		}
+	}
+
+	devices, err := pcap.FindAllDevs()
+	if err != nil {
+		return "", fmt.Errorf("capture: listing devices: %w", err)
+	}
+	for _, dev := range devices {
+		for _, addr := range dev.Addresses {
+			if addr.IP.Equal(ip) {
+				return dev.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("capture: no interface found for %s", host)
+}
+
+// loopbackDevice returns the first pcap-visible interface whose address
+// list includes a loopback IP ("lo" on Linux, "lo0" on BSD/macOS).
+func loopbackDevice() (string, error) {
+	devices, err := pcap.FindAllDevs()
+	if err != nil {
+		return "", err
+	}
+	for _, dev := range devices {
+		for _, addr := range dev.Addresses {
+			if addr.IP.IsLoopback() {
+				return dev.Name, nil
+			}
+		}
+	}
+	return "", fmt.Errorf("capture: no loopback interface found")
+}
+
+// parseTCPPacket extracts the TCP payload and the "host:port" addresses
+// of both ends of the connection from a captured packet. ok is false for
+// anything that isn't an IPv4/IPv6 TCP segment, or that carries no
+// payload (pure ACKs, SYN/FIN control segments).
+func parseTCPPacket(packet gopacket.Packet) (srcAddr, dstAddr string, payload []byte, ok bool) {
+	tcpLayer := packet.Layer(layers.LayerTypeTCP)
+	if tcpLayer == nil {
+		return "", "", nil, false
+	}
+	tcp, _ := tcpLayer.(*layers.TCP)
+	if len(tcp.Payload) == 0 {
+		return "", "", nil, false
+	}
+
+	var srcIP, dstIP net.IP
+	if ip4 := packet.Layer(layers.LayerTypeIPv4); ip4 != nil {
+		l := ip4.(*layers.IPv4)
+		srcIP, dstIP = l.SrcIP, l.DstIP
+	} else if ip6 := packet.Layer(layers.LayerTypeIPv6); ip6 != nil {
+		l := ip6.(*layers.IPv6)
+		srcIP, dstIP = l.SrcIP, l.DstIP
+	} else {
+		return "", "", nil, false
+	}
+
+	srcAddr = net.JoinHostPort(srcIP.String(), fmt.Sprint(uint16(tcp.SrcPort)))
+	dstAddr = net.JoinHostPort(dstIP.String(), fmt.Sprint(uint16(tcp.DstPort)))
+	return srcAddr, dstAddr, tcp.Payload, true
+}
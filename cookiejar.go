@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"sync"
+
+	"github.com/buger/goreplay/proto"
+)
+
+// identityCookieJar keeps one net/http/cookiejar.Jar per client
+// identity (as derived from HTTPOutputConfig.IdentityHeader), so replay
+// traffic captured from different clients doesn't cross-contaminate
+// sessions. Each per-identity jar follows the standard library's
+// domain/path/Secure/Expires scoping rules unchanged.
+type identityCookieJar struct {
+	mu   sync.Mutex
+	jars map[string]*cookiejar.Jar
+}
+
+func newIdentityCookieJar() *identityCookieJar {
+	return &identityCookieJar{jars: make(map[string]*cookiejar.Jar)}
+}
+
+func (c *identityCookieJar) jarFor(identity string) *cookiejar.Jar {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	jar, ok := c.jars[identity]
+	if !ok {
+		// cookiejar.New only errors on an invalid PublicSuffixList, and
+		// we don't supply one.
+		jar, _ = cookiejar.New(nil)
+		c.jars[identity] = jar
+	}
+	return jar
+}
+
+// apply substitutes any cookies previously recorded for identity onto
+// req's Cookie header, replacing same-named cookies the request was
+// captured with rather than appending alongside them — most servers
+// (including net/http's own Request.Cookie) resolve duplicate cookie
+// names to the first occurrence, so simply appending would leave the
+// stale captured session/CSRF cookie taking precedence over the jar's
+// fresher value.
+func (c *identityCookieJar) apply(identity string, req *http.Request) {
+	jarCookies := c.jarFor(identity).Cookies(req.URL)
+	if len(jarCookies) == 0 {
+		return
+	}
+	jarNames := cookieNameSet(jarCookies)
+
+	existing := req.Cookies()
+	req.Header.Del("Cookie")
+	for _, ck := range existing {
+		if !jarNames[ck.Name] {
+			req.AddCookie(ck)
+		}
+	}
+	for _, ck := range jarCookies {
+		req.AddCookie(ck)
+	}
+}
+
+// applyRaw is the raw-header counterpart of apply, used by replay paths
+// (like HTTPOutput's chunked re-emission) that work directly on captured
+// header bytes instead of an *http.Request. It follows the same
+// jar-wins-on-name-collision precedence as apply.
+func (c *identityCookieJar) applyRaw(identity string, u *url.URL, head []byte) []byte {
+	jarCookies := c.jarFor(identity).Cookies(u)
+	if len(jarCookies) == 0 {
+		return head
+	}
+	jarNames := cookieNameSet(jarCookies)
+
+	var existing []*http.Cookie
+	if raw := proto.Header(head, []byte("Cookie")); raw != nil {
+		existing = parseCookieHeader(raw)
+	}
+
+	var buf bytes.Buffer
+	writeCookie := func(ck *http.Cookie) {
+		if buf.Len() > 0 {
+			buf.WriteString("; ")
+		}
+		buf.WriteString(ck.Name)
+		buf.WriteByte('=')
+		buf.WriteString(ck.Value)
+	}
+	for _, ck := range existing {
+		if !jarNames[ck.Name] {
+			writeCookie(ck)
+		}
+	}
+	for _, ck := range jarCookies {
+		writeCookie(ck)
+	}
+
+	return proto.SetHeader(head, []byte("Cookie"), buf.Bytes())
+}
+
+func cookieNameSet(cookies []*http.Cookie) map[string]bool {
+	names := make(map[string]bool, len(cookies))
+	for _, ck := range cookies {
+		names[ck.Name] = true
+	}
+	return names
+}
+
+// parseCookieHeader decodes a raw "Cookie: " header value into
+// individual cookies, reusing net/http's own cookie parsing.
+func parseCookieHeader(raw []byte) []*http.Cookie {
+	req := &http.Request{Header: http.Header{"Cookie": {string(raw)}}}
+	return req.Cookies()
+}
+
+// record stores resp's Set-Cookie headers against identity so the next
+// request for the same identity picks them up via apply.
+func (c *identityCookieJar) record(identity string, u *url.URL, resp *http.Response) {
+	if cookies := resp.Cookies(); len(cookies) > 0 {
+		c.jarFor(identity).SetCookies(u, cookies)
+	}
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestIdentityCookieJarRoundTrip(t *testing.T) {
+	jar := newIdentityCookieJar()
+	u, _ := url.Parse("http://example.com/")
+
+	resp := &http.Response{Header: http.Header{"Set-Cookie": {"session=fresh; Path=/"}}}
+	jar.record("1.2.3.4", u, resp)
+
+	req, _ := http.NewRequest("GET", u.String(), nil)
+	req.Header.Set("Cookie", "session=stale; other=1")
+	jar.apply("1.2.3.4", req)
+
+	got := req.Header.Get("Cookie")
+	if !strings.Contains(got, "session=fresh") {
+		t.Errorf("want fresh session cookie applied, got %q", got)
+	}
+	if strings.Contains(got, "session=stale") {
+		t.Errorf("want stale captured cookie replaced, got %q", got)
+	}
+	if !strings.Contains(got, "other=1") {
+		t.Errorf("want unrelated captured cookie preserved, got %q", got)
+	}
+}
+
+func TestIdentityCookieJarIsolatesIdentities(t *testing.T) {
+	jar := newIdentityCookieJar()
+	u, _ := url.Parse("http://example.com/")
+
+	jar.record("1.1.1.1", u, &http.Response{Header: http.Header{"Set-Cookie": {"session=a"}}})
+	jar.record("2.2.2.2", u, &http.Response{Header: http.Header{"Set-Cookie": {"session=b"}}})
+
+	req, _ := http.NewRequest("GET", u.String(), nil)
+	jar.apply("1.1.1.1", req)
+	if got := req.Header.Get("Cookie"); got != "session=a" {
+		t.Errorf("want session=a for identity 1.1.1.1, got %q", got)
+	}
+}
+
+func TestIdentityCookieJarApplyRaw(t *testing.T) {
+	jar := newIdentityCookieJar()
+	u, _ := url.Parse("http://example.com/")
+
+	jar.record("1.2.3.4", u, &http.Response{Header: http.Header{"Set-Cookie": {"session=fresh; Path=/"}}})
+
+	head := []byte("GET / HTTP/1.1\r\nCookie: session=stale; other=1\r\n\r\n")
+	out := jar.applyRaw("1.2.3.4", u, head)
+
+	if !bytes.Contains(out, []byte("session=fresh")) {
+		t.Errorf("want fresh session cookie applied, got %q", out)
+	}
+	if bytes.Contains(out, []byte("session=stale")) {
+		t.Errorf("want stale captured cookie replaced, got %q", out)
+	}
+	if !bytes.Contains(out, []byte("other=1")) {
+		t.Errorf("want unrelated captured cookie preserved, got %q", out)
+	}
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"sync"
+	"time"
+)
+
+// FastCGI record types, as defined by the FastCGI spec
+// (http://fastcgi-archives.github.io/FastCGI_Specification.html#S8).
+const (
+	fcgiBeginRequest = 1
+	fcgiAbortRequest = 2
+	fcgiEndRequest   = 3
+	fcgiParams       = 4
+	fcgiStdin        = 5
+	fcgiStdout       = 6
+	fcgiStderr       = 7
+	fcgiData         = 8
+)
+
+const fcgiHeaderLen = 8
+
+// fcgiHeader mirrors the 8-byte FCGI_Header record prefix.
+type fcgiHeader struct {
+	version       byte
+	reqType       byte
+	requestID     uint16
+	contentLength uint16
+	paddingLength byte
+}
+
+func parseFCGIHeader(b []byte) (fcgiHeader, bool) {
+	if len(b) < fcgiHeaderLen {
+		return fcgiHeader{}, false
+	}
+	return fcgiHeader{
+		version:       b[0],
+		reqType:       b[1],
+		requestID:     binary.BigEndian.Uint16(b[2:4]),
+		contentLength: binary.BigEndian.Uint16(b[4:6]),
+		paddingLength: b[6],
+	}, true
+}
+
+// fcgiStreamKey identifies a single multiplexed FastCGI exchange on a TCP
+// connection. Keying on requestID (in addition to the 4-tuple) is what
+// lets concurrent multiplexed requests on the same connection be split
+// into separate logical messages.
+type fcgiStreamKey struct {
+	srcAddr   string
+	dstAddr   string
+	requestID uint16
+}
+
+// fcgiMessage accumulates the records belonging to one requestID until the
+// request side (PARAMS+STDIN) or the response side (STDOUT+STDERR+
+// END_REQUEST) is complete.
+type fcgiMessage struct {
+	params     bytes.Buffer
+	stdin      bytes.Buffer
+	stdout     bytes.Buffer
+	stderr     bytes.Buffer
+	paramsDone bool
+	stdinDone  bool
+	reqDone    bool
+	respDone   bool
+
+	// lastSeen is when handleRecord last touched this message, so a
+	// connection that never completes (client abort, reset origin) can
+	// be swept out of messages after expire instead of buffering
+	// forever.
+	lastSeen time.Time
+}
+
+// fcgiAssembler reassembles FastCGI record streams captured from both
+// halves of a TCP connection into logical request/response messages, one
+// per requestID, and hands the reconstructed payload to emit. A message
+// that never completes is dropped once it has been idle longer than
+// expire, if expire is positive.
+type fcgiAssembler struct {
+	mu       sync.Mutex
+	messages map[fcgiStreamKey]*fcgiMessage
+	emit     func(key fcgiStreamKey, isRequest bool, msg *fcgiMessage)
+	expire   time.Duration
+	stop     chan struct{}
+}
+
+func newFCGIAssembler(emit func(fcgiStreamKey, bool, *fcgiMessage), expire time.Duration) *fcgiAssembler {
+	a := &fcgiAssembler{
+		messages: make(map[fcgiStreamKey]*fcgiMessage),
+		emit:     emit,
+		expire:   expire,
+	}
+	if expire > 0 {
+		a.stop = make(chan struct{})
+		go a.expireLoop()
+	}
+	return a
+}
+
+// expireLoop periodically sweeps out messages idle longer than expire.
+// It runs for the lifetime of the assembler, until Close stops it.
+func (a *fcgiAssembler) expireLoop() {
+	ticker := time.NewTicker(a.expire)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.sweep()
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+func (a *fcgiAssembler) sweep() {
+	cutoff := time.Now().Add(-a.expire)
+	a.mu.Lock()
+	for key, msg := range a.messages {
+		if msg.lastSeen.Before(cutoff) {
+			delete(a.messages, key)
+		}
+	}
+	a.mu.Unlock()
+}
+
+// Close stops expireLoop, if one was started.
+func (a *fcgiAssembler) Close() {
+	if a.stop != nil {
+		close(a.stop)
+	}
+}
+
+// Feed consumes as many complete FastCGI records as are present in data
+// and folds them into the message for key, emitting it once a full
+// request or response has been observed. Leftover, not-yet-complete
+// bytes are the caller's responsibility to re-feed once more data
+// arrives (the pcap TCP reassembler already buffers per-stream).
+func (a *fcgiAssembler) Feed(srcAddr, dstAddr string, data []byte) {
+	for len(data) >= fcgiHeaderLen {
+		hdr, ok := parseFCGIHeader(data)
+		if !ok {
+			return
+		}
+		total := fcgiHeaderLen + int(hdr.contentLength) + int(hdr.paddingLength)
+		if len(data) < total {
+			return
+		}
+		content := data[fcgiHeaderLen : fcgiHeaderLen+int(hdr.contentLength)]
+		data = data[total:]
+
+		key := fcgiStreamKey{srcAddr: srcAddr, dstAddr: dstAddr, requestID: hdr.requestID}
+		a.handleRecord(key, hdr.reqType, content)
+	}
+}
+
+func (a *fcgiAssembler) handleRecord(key fcgiStreamKey, reqType byte, content []byte) {
+	a.mu.Lock()
+	msg, ok := a.messages[key]
+	if !ok {
+		msg = &fcgiMessage{}
+		a.messages[key] = msg
+	}
+	msg.lastSeen = time.Now()
+
+	switch reqType {
+	case fcgiBeginRequest:
+		// Nothing to reassemble from the body, the record's presence is
+		// enough to mark the start of a new request.
+	case fcgiParams:
+		if len(content) == 0 {
+			msg.paramsDone = true
+		} else {
+			msg.params.Write(content)
+		}
+	case fcgiStdin:
+		if len(content) == 0 {
+			msg.stdinDone = true
+		} else {
+			msg.stdin.Write(content)
+		}
+	case fcgiStdout:
+		if len(content) > 0 {
+			msg.stdout.Write(content)
+		}
+	case fcgiStderr:
+		if len(content) > 0 {
+			msg.stderr.Write(content)
+		}
+	case fcgiEndRequest, fcgiAbortRequest:
+		msg.respDone = true
+	}
+
+	reqReady := !msg.reqDone && msg.paramsDone && msg.stdinDone
+	if reqReady {
+		msg.reqDone = true
+		// The request side of this requestID is keyed independently of
+		// the response side (it's captured under the opposite
+		// (srcAddr, dstAddr) pair), so it must be cleaned up on its own
+		// rather than waiting on respReady: otherwise a persistent
+		// connection reusing requestID for a second exchange would
+		// append its PARAMS/STDIN into this already-finished message and
+		// never become ready again.
+		delete(a.messages, key)
+	}
+	respReady := msg.respDone
+	if respReady {
+		delete(a.messages, key)
+	}
+	a.mu.Unlock()
+
+	if reqReady {
+		a.emit(key, true, msg)
+	}
+	if respReady {
+		a.emit(key, false, msg)
+	}
+}
+
+// decodeFCGINameValues walks the length-prefixed name/value pairs used by
+// both PARAMS and GET_VALUES records.
+func decodeFCGINameValues(b []byte) map[string]string {
+	out := make(map[string]string)
+	for len(b) > 0 {
+		nameLen, n1, ok := readFCGILength(b)
+		if !ok {
+			break
+		}
+		b = b[n1:]
+		valueLen, n2, ok := readFCGILength(b)
+		if !ok {
+			break
+		}
+		b = b[n2:]
+		if len(b) < int(nameLen+valueLen) {
+			break
+		}
+		name := string(b[:nameLen])
+		value := string(b[nameLen : nameLen+valueLen])
+		out[name] = value
+		b = b[nameLen+valueLen:]
+	}
+	return out
+}
+
+// readFCGILength decodes the 1-or-4-byte length encoding used for
+// FastCGI name/value pair lengths: lengths under 128 use a single byte,
+// larger ones use 4 bytes with the high bit of the first byte set.
+func readFCGILength(b []byte) (length uint32, consumed int, ok bool) {
+	if len(b) == 0 {
+		return 0, 0, false
+	}
+	if b[0]>>7 == 0 {
+		return uint32(b[0]), 1, true
+	}
+	if len(b) < 4 {
+		return 0, 0, false
+	}
+	length = binary.BigEndian.Uint32(b[:4]) & 0x7fffffff
+	return length, 4, true
+}
+
+// encodeFCGINameValues is the inverse of decodeFCGINameValues, used when
+// re-encoding captured PARAMS for replay against a staging fcgi socket.
+func encodeFCGINameValues(params map[string]string) []byte {
+	var buf bytes.Buffer
+	for name, value := range params {
+		writeFCGILength(&buf, len(name))
+		writeFCGILength(&buf, len(value))
+		buf.WriteString(name)
+		buf.WriteString(value)
+	}
+	return buf.Bytes()
+}
+
+func writeFCGILength(buf *bytes.Buffer, length int) {
+	if length < 128 {
+		buf.WriteByte(byte(length))
+		return
+	}
+	var b [4]byte
+	binary.BigEndian.PutUint32(b[:], uint32(length)|0x80000000)
+	buf.Write(b[:])
+}
+
+// buildFCGIPayload renders a reassembled fcgiMessage into the payload
+// body RAWInput writes after the usual meta-prefix line: a 4-byte
+// big-endian length prefix followed by that many bytes of the CGI
+// name/value pairs (request side) or stdout (response side), then
+// whatever follows (stdin, or stderr). The length prefix, rather than a
+// textual separator, is what lets splitFCGIPayload in FastCGIOutput find
+// the boundary again even though both halves are arbitrary binary data.
+func buildFCGIPayload(msg *fcgiMessage, isRequest bool) []byte {
+	var head, tail []byte
+	if isRequest {
+		params := decodeFCGINameValues(msg.params.Bytes())
+		head = encodeFCGINameValues(params)
+		tail = msg.stdin.Bytes()
+	} else {
+		head = msg.stdout.Bytes()
+		tail = msg.stderr.Bytes()
+	}
+
+	var buf bytes.Buffer
+	var lenPrefix [4]byte
+	binary.BigEndian.PutUint32(lenPrefix[:], uint32(len(head)))
+	buf.Write(lenPrefix[:])
+	buf.Write(head)
+	buf.Write(tail)
+	return buf.Bytes()
+}
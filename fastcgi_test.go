@@ -0,0 +1,233 @@
+package main
+
+import (
+	"encoding/binary"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// buildFCGIRecord renders one raw FastCGI record: an 8-byte header
+// followed by content, no padding.
+func buildFCGIRecord(reqType byte, requestID uint16, content []byte) []byte {
+	b := make([]byte, fcgiHeaderLen+len(content))
+	b[0] = 1 // FCGI_VERSION_1
+	b[1] = reqType
+	binary.BigEndian.PutUint16(b[2:4], requestID)
+	binary.BigEndian.PutUint16(b[4:6], uint16(len(content)))
+	copy(b[fcgiHeaderLen:], content)
+	return b
+}
+
+func TestParseFCGIHeader(t *testing.T) {
+	record := buildFCGIRecord(fcgiStdout, 7, []byte("hello"))
+
+	hdr, ok := parseFCGIHeader(record)
+	if !ok {
+		t.Fatal("want ok")
+	}
+	if hdr.reqType != fcgiStdout || hdr.requestID != 7 || hdr.contentLength != 5 {
+		t.Errorf("got %+v", hdr)
+	}
+
+	if _, ok := parseFCGIHeader(record[:4]); ok {
+		t.Error("want not ok for a short buffer")
+	}
+}
+
+func TestFCGINameValuesRoundTrip(t *testing.T) {
+	params := map[string]string{
+		"REQUEST_METHOD": "POST",
+		"SCRIPT_NAME":    "/index.php",
+	}
+
+	got := decodeFCGINameValues(encodeFCGINameValues(params))
+	if !reflect.DeepEqual(got, params) {
+		t.Errorf("want %v, got %v", params, got)
+	}
+}
+
+func TestFCGIAssemblerMultiplexedRequests(t *testing.T) {
+	type emitted struct {
+		key       fcgiStreamKey
+		isRequest bool
+		params    map[string]string
+		body      []byte
+	}
+	var got []emitted
+
+	a := newFCGIAssembler(func(key fcgiStreamKey, isRequest bool, msg *fcgiMessage) {
+		got = append(got, emitted{
+			key:       key,
+			isRequest: isRequest,
+			params:    decodeFCGINameValues(msg.params.Bytes()),
+			body:      append([]byte{}, msg.stdin.Bytes()...),
+		})
+	}, 0)
+
+	const src, dst = "10.0.0.1:5555", "10.0.0.2:9000"
+
+	// Interleave two concurrent requestIDs on the same 4-tuple, which is
+	// exactly what a multiplexed FastCGI connection looks like on the
+	// wire, and exactly what keying by requestId (not just the 4-tuple)
+	// is meant to split back apart.
+	var data []byte
+	data = append(data, buildFCGIRecord(fcgiBeginRequest, 1, []byte{0, 1, 0, 0, 0, 0, 0, 0})...)
+	data = append(data, buildFCGIRecord(fcgiBeginRequest, 2, []byte{0, 1, 0, 0, 0, 0, 0, 0})...)
+	data = append(data, buildFCGIRecord(fcgiParams, 1, encodeFCGINameValues(map[string]string{"SCRIPT_NAME": "/a.php"}))...)
+	data = append(data, buildFCGIRecord(fcgiParams, 2, encodeFCGINameValues(map[string]string{"SCRIPT_NAME": "/b.php"}))...)
+	data = append(data, buildFCGIRecord(fcgiParams, 1, nil)...)
+	data = append(data, buildFCGIRecord(fcgiParams, 2, nil)...)
+	data = append(data, buildFCGIRecord(fcgiStdin, 2, []byte("b=2"))...)
+	data = append(data, buildFCGIRecord(fcgiStdin, 1, []byte("a=1"))...)
+	data = append(data, buildFCGIRecord(fcgiStdin, 1, nil)...)
+	data = append(data, buildFCGIRecord(fcgiStdin, 2, nil)...)
+
+	a.Feed(src, dst, data)
+
+	if len(got) != 2 {
+		t.Fatalf("want 2 completed requests, got %d", len(got))
+	}
+	byID := map[uint16]emitted{}
+	for _, e := range got {
+		byID[e.key.requestID] = e
+	}
+
+	if string(byID[1].body) != "a=1" || byID[1].params["SCRIPT_NAME"] != "/a.php" {
+		t.Errorf("request 1 mismatched, got %+v", byID[1])
+	}
+	if string(byID[2].body) != "b=2" || byID[2].params["SCRIPT_NAME"] != "/b.php" {
+		t.Errorf("request 2 mismatched, got %+v", byID[2])
+	}
+}
+
+func TestFCGIAssemblerReusedRequestID(t *testing.T) {
+	var got []string
+	a := newFCGIAssembler(func(key fcgiStreamKey, isRequest bool, msg *fcgiMessage) {
+		if !isRequest {
+			return
+		}
+		got = append(got, string(msg.stdin.Bytes()))
+	}, 0)
+
+	const src, dst = "10.0.0.1:5555", "10.0.0.2:9000"
+
+	// A persistent php-fpm connection reuses requestID 1 for a second,
+	// unrelated exchange once the first has fully completed -- this is
+	// the normal keep-alive case, not the concurrent-multiplexed-IDs
+	// case TestFCGIAssemblerMultiplexedRequests covers.
+	exchange := func(body string) []byte {
+		var data []byte
+		data = append(data, buildFCGIRecord(fcgiBeginRequest, 1, []byte{0, 1, 0, 0, 0, 0, 0, 0})...)
+		data = append(data, buildFCGIRecord(fcgiParams, 1, encodeFCGINameValues(map[string]string{"SCRIPT_NAME": "/a.php"}))...)
+		data = append(data, buildFCGIRecord(fcgiParams, 1, nil)...)
+		data = append(data, buildFCGIRecord(fcgiStdin, 1, []byte(body))...)
+		data = append(data, buildFCGIRecord(fcgiStdin, 1, nil)...)
+		return data
+	}
+
+	a.Feed(src, dst, exchange("first"))
+	a.Feed(src, dst, exchange("second"))
+
+	if len(a.messages) != 0 {
+		t.Errorf("want no leftover request-side entries, got %d", len(a.messages))
+	}
+	if want := []string{"first", "second"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+}
+
+func TestFCGIAssemblerExpiresStaleMessage(t *testing.T) {
+	a := newFCGIAssembler(func(fcgiStreamKey, bool, *fcgiMessage) {}, 10*time.Millisecond)
+	defer a.Close()
+
+	// A BEGIN_REQUEST with no matching PARAMS/STDIN never completes --
+	// exactly the shape of a client that opens a connection and vanishes
+	// mid-request.
+	data := buildFCGIRecord(fcgiBeginRequest, 1, []byte{0, 1, 0, 0, 0, 0, 0, 0})
+	a.Feed("src:1", "dst:2", data)
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		a.mu.Lock()
+		n := len(a.messages)
+		a.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("want the stale message swept after expire")
+}
+
+func TestFCGIAssemblerTruncatedRecord(t *testing.T) {
+	emitted := false
+	a := newFCGIAssembler(func(fcgiStreamKey, bool, *fcgiMessage) { emitted = true }, 0)
+
+	full := buildFCGIRecord(fcgiParams, 1, []byte("partial-content"))
+	// Feed everything but the last 3 bytes of the record: Feed must not
+	// panic on a header whose declared contentLength outruns the buffer,
+	// and must not emit anything since no complete record was seen.
+	a.Feed("src:1", "dst:2", full[:len(full)-3])
+	if emitted {
+		t.Error("want no emission from a truncated record")
+	}
+}
+
+func TestFCGIAssemblerResponse(t *testing.T) {
+	var gotRequest, gotResponse bool
+	a := newFCGIAssembler(func(key fcgiStreamKey, isRequest bool, msg *fcgiMessage) {
+		if isRequest {
+			gotRequest = true
+			return
+		}
+		gotResponse = true
+		if string(msg.stdout.Bytes()) != "hello" {
+			t.Errorf("want stdout hello, got %q", msg.stdout.Bytes())
+		}
+	}, 0)
+
+	const src, dst = "10.0.0.2:9000", "10.0.0.1:5555"
+	var data []byte
+	data = append(data, buildFCGIRecord(fcgiStdout, 1, []byte("hello"))...)
+	data = append(data, buildFCGIRecord(fcgiEndRequest, 1, []byte{0, 0, 0, 0, 0, 0, 0, 0})...)
+	a.Feed(src, dst, data)
+
+	if gotRequest {
+		t.Error("want no request-side emission from response records")
+	}
+	if !gotResponse {
+		t.Error("want a response-side emission")
+	}
+}
+
+func TestFCGIPayloadFraming(t *testing.T) {
+	msg := &fcgiMessage{}
+	msg.params.Write(encodeFCGINameValues(map[string]string{"SCRIPT_NAME": "/a.php"}))
+	msg.stdin.WriteString("a=1&b=2")
+
+	payload := buildFCGIPayload(msg, true)
+	params, body := splitFCGIPayload(payload)
+	if string(body) != "a=1&b=2" {
+		t.Errorf("want body a=1&b=2, got %q", body)
+	}
+	if got := decodeFCGINameValues(params); got["SCRIPT_NAME"] != "/a.php" {
+		t.Errorf("want SCRIPT_NAME /a.php, got %v", got)
+	}
+}
+
+func TestFCGIPayloadFramingSurvivesEmbeddedSeparator(t *testing.T) {
+	// A length-10 FCGI name/value field encodes its length as the raw
+	// byte 0x0A ('\n'); two of them back to back used to be
+	// indistinguishable from the old "\n\n" textual separator between
+	// params and stdin.
+	msg := &fcgiMessage{}
+	msg.params.Write(encodeFCGINameValues(map[string]string{"XXXXXXXXXX": "aaaaaaaaaa"}))
+	msg.stdin.WriteString("\n\nbinary-body")
+
+	payload := buildFCGIPayload(msg, true)
+	_, body := splitFCGIPayload(payload)
+	if string(body) != "\n\nbinary-body" {
+		t.Errorf("want body preserved verbatim, got %q", body)
+	}
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/buger/goreplay/proto"
+)
+
+// httpStreamKey identifies one direction of one TCP connection carrying
+// HTTP traffic: the (srcAddr, dstAddr) pair a captured segment arrived
+// with.
+type httpStreamKey struct {
+	srcAddr string
+	dstAddr string
+}
+
+// httpStreamBuffer is the partial message buffered for one httpStreamKey
+// so far, plus when it was last appended to, so httpAssembler can sweep
+// out a connection that never completes.
+type httpStreamBuffer struct {
+	buf      bytes.Buffer
+	lastSeen time.Time
+}
+
+// httpAssembler buffers captured TCP payload per stream direction and
+// splits it into complete HTTP/1.x messages, using Content-Length or
+// Transfer-Encoding: chunked (whichever the message declares) to find
+// each message's end the same way proto and HTTPOutput already reason
+// about framing, rather than re-parsing with net/http. A stream that
+// never completes a message is dropped once it has been idle longer
+// than expire, if expire is positive.
+type httpAssembler struct {
+	mu        sync.Mutex
+	buffers   map[httpStreamKey]*httpStreamBuffer
+	localAddr string
+	emit      func(isRequest bool, raw []byte)
+	expire    time.Duration
+	stop      chan struct{}
+}
+
+func newHTTPAssembler(localAddr string, emit func(isRequest bool, raw []byte), expire time.Duration) *httpAssembler {
+	a := &httpAssembler{
+		buffers:   make(map[httpStreamKey]*httpStreamBuffer),
+		localAddr: localAddr,
+		emit:      emit,
+		expire:    expire,
+	}
+	if expire > 0 {
+		a.stop = make(chan struct{})
+		go a.expireLoop()
+	}
+	return a
+}
+
+// expireLoop periodically sweeps out stream buffers idle longer than
+// expire. It runs for the lifetime of the assembler, until Close stops
+// it.
+func (a *httpAssembler) expireLoop() {
+	ticker := time.NewTicker(a.expire)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			a.sweep()
+		case <-a.stop:
+			return
+		}
+	}
+}
+
+func (a *httpAssembler) sweep() {
+	cutoff := time.Now().Add(-a.expire)
+	a.mu.Lock()
+	for key, buf := range a.buffers {
+		if buf.lastSeen.Before(cutoff) {
+			delete(a.buffers, key)
+		}
+	}
+	a.mu.Unlock()
+}
+
+// Close stops expireLoop, if one was started.
+func (a *httpAssembler) Close() {
+	if a.stop != nil {
+		close(a.stop)
+	}
+}
+
+// Feed appends data to the buffer for the (srcAddr, dstAddr) stream and
+// emits every complete HTTP message that buffer now holds. A segment is
+// a request if it's addressed to the captured service (dstAddr ==
+// localAddr) and a response otherwise, which is enough to pick the right
+// framing rules without tracking per-connection state beyond the buffer
+// itself.
+func (a *httpAssembler) Feed(srcAddr, dstAddr string, data []byte) {
+	key := httpStreamKey{srcAddr: srcAddr, dstAddr: dstAddr}
+
+	a.mu.Lock()
+	buf, ok := a.buffers[key]
+	if !ok {
+		buf = new(httpStreamBuffer)
+		a.buffers[key] = buf
+	}
+	buf.lastSeen = time.Now()
+	buf.buf.Write(data)
+
+	var complete [][]byte
+	for {
+		raw, ok := extractHTTPMessage(&buf.buf)
+		if !ok {
+			break
+		}
+		complete = append(complete, raw)
+	}
+	a.mu.Unlock()
+
+	isRequest := dstAddr == a.localAddr
+	for _, raw := range complete {
+		a.emit(isRequest, raw)
+	}
+}
+
+// extractHTTPMessage pops one complete HTTP message off the front of buf
+// and reports ok, or leaves buf untouched and returns ok=false if it
+// doesn't yet hold a full message.
+func extractHTTPMessage(buf *bytes.Buffer) (raw []byte, ok bool) {
+	data := buf.Bytes()
+	headerEnd := bytes.Index(data, []byte("\r\n\r\n"))
+	if headerEnd < 0 {
+		return nil, false
+	}
+	headerEnd += 4
+
+	parser := proto.AcquireRequest(data[:headerEnd])
+	contentLength := parser.Header([]byte("Content-Length"))
+	transferEncoding := parser.Header([]byte("Transfer-Encoding"))
+	proto.ReleaseRequest(parser)
+
+	var total int
+	switch {
+	case bytes.EqualFold(bytes.TrimSpace(transferEncoding), []byte("chunked")):
+		bodyLen, ok := chunkedBodyLen(data[headerEnd:])
+		if !ok {
+			return nil, false
+		}
+		total = headerEnd + bodyLen
+	case len(contentLength) > 0:
+		n, err := strconv.Atoi(string(bytes.TrimSpace(contentLength)))
+		if err != nil || n < 0 {
+			n = 0
+		}
+		total = headerEnd + n
+	default:
+		total = headerEnd
+	}
+	if len(data) < total {
+		return nil, false
+	}
+
+	raw = append([]byte(nil), data[:total]...)
+	buf.Next(total)
+	return raw, true
+}
+
+// chunkedBodyLen mirrors proto.ChunkIter's scan over a chunked-encoding
+// body, but reports how many bytes the body (every chunk plus the
+// trailing trailer block) takes up instead of iterating its chunks --
+// extractHTTPMessage needs the length to know a message is complete
+// before there's a full body to hand ChunkIter for replay.
+func chunkedBodyLen(body []byte) (n int, ok bool) {
+	pos := 0
+	for {
+		rest := body[pos:]
+		lineEnd := bytes.IndexByte(rest, '\n')
+		if lineEnd < 0 {
+			return 0, false
+		}
+		sizeLine := bytes.TrimSuffix(rest[:lineEnd], []byte("\r"))
+		if semi := bytes.IndexByte(sizeLine, ';'); semi >= 0 {
+			sizeLine = sizeLine[:semi]
+		}
+		size, err := strconv.ParseInt(string(bytes.TrimSpace(sizeLine)), 16, 64)
+		if err != nil {
+			return 0, false
+		}
+		pos += lineEnd + 1
+
+		if size == 0 {
+			if bytes.HasPrefix(body[pos:], []byte("\r\n")) {
+				return pos + 2, true
+			}
+			trailerEnd := bytes.Index(body[pos:], []byte("\r\n\r\n"))
+			if trailerEnd < 0 {
+				return 0, false
+			}
+			return pos + trailerEnd + 4, true
+		}
+
+		if int64(len(body)-pos) < size {
+			return 0, false
+		}
+		pos += int(size)
+		if len(body)-pos < 2 {
+			return 0, false
+		}
+		pos += 2
+	}
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestHTTPAssemblerContentLength(t *testing.T) {
+	var got []byte
+	a := newHTTPAssembler("127.0.0.1:80", func(isRequest bool, raw []byte) {
+		if !isRequest {
+			t.Fatalf("want a request, got a response: %q", raw)
+		}
+		got = raw
+	}, 0)
+
+	req := []byte("GET / HTTP/1.1\r\nHost: x\r\nContent-Length: 5\r\n\r\nhello")
+	// Feed split across two segments, as a real captured stream would
+	// arrive.
+	a.Feed("10.0.0.1:5555", "127.0.0.1:80", req[:10])
+	a.Feed("10.0.0.1:5555", "127.0.0.1:80", req[10:])
+
+	if !bytes.Equal(got, req) {
+		t.Errorf("want %q, got %q", req, got)
+	}
+}
+
+func TestHTTPAssemblerChunked(t *testing.T) {
+	var got []byte
+	a := newHTTPAssembler("127.0.0.1:80", func(isRequest bool, raw []byte) {
+		if isRequest {
+			t.Fatalf("want a response, got a request: %q", raw)
+		}
+		got = raw
+	}, 0)
+
+	resp := []byte("HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n5\r\nhello\r\n0\r\n\r\n")
+	a.Feed("127.0.0.1:80", "10.0.0.1:5555", resp)
+
+	if !bytes.Equal(got, resp) {
+		t.Errorf("want %q, got %q", resp, got)
+	}
+}
+
+func TestHTTPAssemblerPipelinedRequests(t *testing.T) {
+	var got [][]byte
+	a := newHTTPAssembler("127.0.0.1:80", func(isRequest bool, raw []byte) {
+		got = append(got, raw)
+	}, 0)
+
+	one := []byte("GET /a HTTP/1.1\r\nHost: x\r\n\r\n")
+	two := append(append([]byte{}, one...), one...)
+	a.Feed("10.0.0.1:5555", "127.0.0.1:80", two)
+
+	if len(got) != 2 {
+		t.Fatalf("want 2 reassembled requests from one pipelined segment, got %d", len(got))
+	}
+	for _, raw := range got {
+		if !bytes.Equal(raw, one) {
+			t.Errorf("want %q, got %q", one, raw)
+		}
+	}
+}
+
+func TestHTTPAssemblerExpiresStaleStream(t *testing.T) {
+	a := newHTTPAssembler("127.0.0.1:80", func(bool, []byte) {}, 10*time.Millisecond)
+	defer a.Close()
+
+	// Headers with no blank line to terminate them and no Content-Length
+	// ever arrive -- exactly the shape of a client that opens a
+	// connection and vanishes mid-request.
+	a.Feed("10.0.0.1:5555", "127.0.0.1:80", []byte("GET / HTTP/1.1\r\nHost: x\r\n"))
+
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		a.mu.Lock()
+		n := len(a.buffers)
+		a.mu.Unlock()
+		if n == 0 {
+			return
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	t.Error("want the stale stream buffer swept after expire")
+}
@@ -433,3 +433,45 @@ func BenchmarkRAWInputWithReplay(b *testing.B) {
 	b.Logf("Captured %d Requests, %d Responses, %d Replayed, %d Bytes in %s\n", reqCounter, respCounter, replayCounter, capturedBody, time.Since(now))
 	emitter.Close()
 }
+
+// TestRAWInputEmitHTTPRequestAllocs exercises emitHTTPRequest the same
+// way httpAssembler's completion callback does on the hot path: a
+// request that already carries the configured real-IP header, so the
+// only work is the pooled RequestParser's Header lookup, not
+// proto.SetHeader's rewrite.
+func TestRAWInputEmitHTTPRequestAllocs(t *testing.T) {
+	input := &RAWInput{
+		address: "127.0.0.1:80",
+		config:  RAWInputConfig{realIPHeader: "X-Real-IP"},
+	}
+	payload := []byte("GET / HTTP/1.1\r\nHost: x\r\nX-Real-IP: 1.2.3.4\r\n\r\n")
+
+	allocs := testing.AllocsPerRun(1000, func() {
+		input.emitHTTPRequest(payload)
+	})
+	if allocs != 0 {
+		t.Errorf("want 0 allocs per emitHTTPRequest, got %v", allocs)
+	}
+}
+
+func TestRAWInputReadSmallBuffer(t *testing.T) {
+	input := &RAWInput{messages: make(chan *Message, 1)}
+	input.messages <- &Message{Meta: []byte{'1'}, Data: []byte("0123456789")}
+
+	const want = "1\n0123456789"
+	var got []byte
+	buf := make([]byte, 4)
+	for len(got) < len(want) {
+		n, err := input.Read(buf)
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if n == 0 {
+			t.Fatal("want progress on every Read, got n=0")
+		}
+		got = append(got, buf[:n]...)
+	}
+	if string(got) != want {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
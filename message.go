@@ -0,0 +1,22 @@
+package main
+
+import "bytes"
+
+// Message is one logical request or response RAWInput emits: Meta is the
+// single-byte payload-type prefix ('1' for a request, '2' for a
+// response), Data is the reassembled message body (an HTTP message for
+// ProtocolHTTP, the params+body/stdout+stderr payload built by
+// buildFCGIPayload for ProtocolFastCGI).
+type Message struct {
+	Meta []byte
+	Data []byte
+}
+
+// payloadBody strips Message.Meta's leading line from a captured frame,
+// returning just the underlying protocol payload.
+func payloadBody(data []byte) []byte {
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return data[i+1:]
+	}
+	return data
+}
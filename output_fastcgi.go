@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+	"time"
+)
+
+// FastCGIOutputConfig controls how FastCGIOutput replays reconstructed
+// ProtocolFastCGI traffic against its target address, mirroring
+// HTTPOutputConfig's Timeout so the two outputs are configured the same
+// way.
+type FastCGIOutputConfig struct {
+	Timeout time.Duration
+}
+
+// FastCGIOutput replays captured FastCGI request messages (produced by
+// RAWInput configured with ProtocolFastCGI) against a staging fcgi
+// socket, such as one exposed by php-fpm.
+type FastCGIOutput struct {
+	address string
+	config  *FastCGIOutputConfig
+}
+
+// NewFastCGIOutput returns a FastCGIOutput writing to address, which may
+// be a "host:port" TCP address or a "unix:/path/to.sock" socket.
+func NewFastCGIOutput(address string, config *FastCGIOutputConfig) *FastCGIOutput {
+	if config == nil {
+		config = &FastCGIOutputConfig{}
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 5 * time.Second
+	}
+	return &FastCGIOutput{address: address, config: config}
+}
+
+func (o *FastCGIOutput) dial() (net.Conn, error) {
+	network, addr := "tcp", o.address
+	const unixPrefix = "unix:"
+	if len(o.address) > len(unixPrefix) && o.address[:len(unixPrefix)] == unixPrefix {
+		network, addr = "unix", o.address[len(unixPrefix):]
+	}
+	return net.DialTimeout(network, addr, o.config.Timeout)
+}
+
+// Write replays a captured FastCGI request payload (meta-prefixed with
+// '1', body holding the 4-byte length-prefixed CGI name/value params
+// followed by the STDIN body, as built by buildFCGIPayload) against the configured fcgi socket. It implements
+// io.Writer so FastCGIOutput can sit in InOutPlugins.Outputs alongside
+// HTTPOutput and TestOutput.
+func (o *FastCGIOutput) Write(data []byte) (n int, err error) {
+	if data[0] != '1' {
+		return len(data), nil
+	}
+
+	conn, err := o.dial()
+	if err != nil {
+		return 0, err
+	}
+	defer conn.Close()
+
+	params, body := splitFCGIPayload(payloadBody(data))
+
+	const requestID = 1
+	if err := writeFCGIRecord(conn, fcgiBeginRequest, requestID, []byte{0, 1, 0, 0, 0, 0, 0, 0}); err != nil {
+		return 0, err
+	}
+	if err := writeFCGIRecord(conn, fcgiParams, requestID, params); err != nil {
+		return 0, err
+	}
+	if err := writeFCGIRecord(conn, fcgiParams, requestID, nil); err != nil {
+		return 0, err
+	}
+	if err := writeFCGIRecord(conn, fcgiStdin, requestID, body); err != nil {
+		return 0, err
+	}
+	if err := writeFCGIRecord(conn, fcgiStdin, requestID, nil); err != nil {
+		return 0, err
+	}
+
+	return len(data), nil
+}
+
+func (o *FastCGIOutput) String() string {
+	return fmt.Sprintf("FastCGI output: %s", o.address)
+}
+
+// splitFCGIPayload separates the reconstructed CGI name/value params from
+// the request body in the meta-prefixed payload RAWInput emits for
+// ProtocolFastCGI: a 4-byte big-endian length prefix naming how many of
+// the following bytes are the params blob built by
+// encodeFCGINameValues, then the raw STDIN bytes. The length prefix
+// (rather than a textual separator) is required because the params blob
+// is binary and can itself contain "\n\n".
+func splitFCGIPayload(data []byte) (params, body []byte) {
+	const lenPrefix = 4
+	if len(data) < lenPrefix {
+		return data, nil
+	}
+	paramsLen := binary.BigEndian.Uint32(data[:lenPrefix])
+	data = data[lenPrefix:]
+	if uint64(paramsLen) > uint64(len(data)) {
+		return data, nil
+	}
+	return data[:paramsLen], data[paramsLen:]
+}
+
+// writeFCGIRecord splits content into records no larger than a FastCGI
+// record's 16-bit length field allows, writing at least one (possibly
+// empty) record so callers can emit the empty-record terminator PARAMS
+// and STDIN both require.
+func writeFCGIRecord(w net.Conn, reqType byte, requestID uint16, content []byte) error {
+	const maxChunk = 0xffff
+	for {
+		chunk := content
+		if len(chunk) > maxChunk {
+			chunk = chunk[:maxChunk]
+		}
+		if err := writeFCGIChunk(w, reqType, requestID, chunk); err != nil {
+			return err
+		}
+		content = content[len(chunk):]
+		if len(content) == 0 {
+			return nil
+		}
+	}
+}
+
+func writeFCGIChunk(w net.Conn, reqType byte, requestID uint16, content []byte) error {
+	hdr := make([]byte, fcgiHeaderLen)
+	hdr[0] = 1 // FCGI_VERSION_1
+	hdr[1] = reqType
+	binary.BigEndian.PutUint16(hdr[2:4], requestID)
+	binary.BigEndian.PutUint16(hdr[4:6], uint16(len(content)))
+	if _, err := w.Write(hdr); err != nil {
+		return err
+	}
+	if len(content) == 0 {
+		return nil
+	}
+	_, err := w.Write(content)
+	return err
+}
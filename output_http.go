@@ -0,0 +1,210 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/buger/goreplay/proto"
+)
+
+// HTTPOutputConfig controls how HTTPOutput replays captured requests
+// against its target address.
+type HTTPOutputConfig struct {
+	// Debug logs every replayed request and the response it got back.
+	Debug bool
+
+	// Timeout bounds how long a single replayed request may take.
+	Timeout time.Duration
+
+	// CookieJar, when true, keeps a per-identity cookie store so
+	// Set-Cookie values observed on earlier replay responses are carried
+	// forward onto later requests for the same identity, the way a real
+	// browser session would. Without it every captured request replays
+	// with whatever cookies it was captured with, which breaks apps that
+	// issue a fresh session or CSRF token during login.
+	CookieJar bool
+
+	// IdentityHeader names the captured request header HTTPOutput uses
+	// to tell which client a request belongs to when CookieJar is
+	// enabled. Defaults to X-Real-IP, which RAWInput already populates.
+	IdentityHeader string
+
+	// PreserveTransferEncoding, when true and the captured request used
+	// Transfer-Encoding: chunked, re-emits the body on the wire using
+	// its original chunk boundaries instead of buffering it behind a
+	// synthesized Content-Length, and forwards any Trailer-declared
+	// headers that followed the terminating chunk. Without this, large
+	// streamed uploads (gRPC-over-h1, big binary POSTs) get fully
+	// buffered in memory by net/http before being replayed.
+	PreserveTransferEncoding bool
+}
+
+// HTTPOutput replays captured HTTP requests against address.
+type HTTPOutput struct {
+	address string
+	config  *HTTPOutputConfig
+	client  *http.Client
+	jar     *identityCookieJar
+}
+
+// NewHTTPOutput returns an HTTPOutput writing to address.
+func NewHTTPOutput(address string, config *HTTPOutputConfig) *HTTPOutput {
+	if config == nil {
+		config = &HTTPOutputConfig{}
+	}
+	if config.Timeout == 0 {
+		config.Timeout = 5 * time.Second
+	}
+	if config.IdentityHeader == "" {
+		config.IdentityHeader = "X-Real-IP"
+	}
+
+	o := &HTTPOutput{
+		address: address,
+		config:  config,
+		client:  &http.Client{Timeout: config.Timeout},
+	}
+	if config.CookieJar {
+		o.jar = newIdentityCookieJar()
+	}
+	return o
+}
+
+// Write replays a captured request payload against o.address,
+// substituting cookies for the request's identity when CookieJar is
+// enabled and recording any Set-Cookie the replay response returns. It
+// implements io.Writer so HTTPOutput can sit in InOutPlugins.Outputs
+// alongside FastCGIOutput and TestOutput.
+func (o *HTTPOutput) Write(data []byte) (n int, err error) {
+	if data[0] != '1' {
+		return len(data), nil
+	}
+	body := payloadBody(data)
+
+	if o.config.PreserveTransferEncoding && isChunkedRequest(body) {
+		if err := o.replayChunked(body); err != nil {
+			return 0, err
+		}
+		return len(data), nil
+	}
+
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(body)))
+	if err != nil {
+		return 0, err
+	}
+	req.RequestURI = ""
+	req.URL.Scheme = "http"
+	req.URL.Host = o.address
+
+	var identity string
+	if o.jar != nil {
+		identity = req.Header.Get(o.config.IdentityHeader)
+		o.jar.apply(identity, req)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+
+	if o.jar != nil {
+		o.jar.record(identity, req.URL, resp)
+	}
+
+	if o.config.Debug {
+		log.Printf("[HTTPOutput] %s %s -> %d (%d bytes)", req.Method, req.URL, resp.StatusCode, len(respBody))
+	}
+
+	return len(data), nil
+}
+
+func (o *HTTPOutput) String() string {
+	return fmt.Sprintf("HTTP output: %s", o.address)
+}
+
+func isChunkedRequest(data []byte) bool {
+	return bytes.EqualFold(proto.Header(data, []byte("Transfer-Encoding")), []byte("chunked"))
+}
+
+// replayChunked re-emits a captured chunked request over a raw
+// connection to o.address, walking the original body with
+// proto.ChunkIter so each chunk goes out with its original boundaries
+// and any trailers are forwarded as-is, instead of buffering the whole
+// body behind a synthesized Content-Length the way http.Client would. If
+// the capture was truncated mid-chunk, proto.ChunkIter returns
+// ErrTruncatedChunk instead of a partial chunk, and replayChunked aborts
+// the connection rather than leaving an unterminated chunked request
+// hanging on the wire.
+func (o *HTTPOutput) replayChunked(data []byte) error {
+	headEnd := bytes.Index(data, []byte("\r\n\r\n"))
+	if headEnd < 0 {
+		return fmt.Errorf("output_http: malformed chunked request, missing header terminator")
+	}
+	head := proto.SetHeader(data[:headEnd+4], []byte("Host"), []byte(o.address))
+	body := data[headEnd+4:]
+
+	var identity string
+	var targetURL *url.URL
+	if o.jar != nil {
+		var uerr error
+		identity = string(proto.Header(head, []byte(o.config.IdentityHeader)))
+		targetURL, uerr = url.Parse("http://" + o.address)
+		if uerr != nil {
+			return uerr
+		}
+		head = o.jar.applyRaw(identity, targetURL, head)
+	}
+
+	conn, err := net.DialTimeout("tcp", o.address, o.config.Timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(o.config.Timeout))
+
+	if _, err := conn.Write(head); err != nil {
+		return err
+	}
+
+	if err := proto.ChunkIter(body, func(c proto.Chunk) error {
+		if c.Trailers != nil {
+			_, err := conn.Write(append([]byte("0\r\n"), c.Trailers...))
+			return err
+		}
+		if _, err := fmt.Fprintf(conn, "%x\r\n", len(c.Data)); err != nil {
+			return err
+		}
+		if _, err := conn.Write(c.Data); err != nil {
+			return err
+		}
+		_, err := conn.Write([]byte("\r\n"))
+		return err
+	}); err != nil {
+		return err
+	}
+
+	resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	respBody, _ := ioutil.ReadAll(resp.Body)
+
+	if o.jar != nil {
+		o.jar.record(identity, targetURL, resp)
+	}
+
+	if o.config.Debug {
+		log.Printf("[HTTPOutput] chunked replay -> %d (%d bytes)", resp.StatusCode, len(respBody))
+	}
+	return nil
+}
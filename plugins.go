@@ -0,0 +1,50 @@
+package main
+
+import "io"
+
+// InOutPlugins groups the configured input and output plugins for a
+// single goreplay run.
+type InOutPlugins struct {
+	Inputs  []io.Reader
+	Outputs []io.Writer
+	All     []interface{}
+}
+
+// OutputPluginConfig is the address plus plugin-specific config for one
+// configured output, as parsed from the matching --output-<kind> flag.
+type OutputPluginConfig struct {
+	Kind    string
+	Address string
+	HTTP    *HTTPOutputConfig
+	FastCGI *FastCGIOutputConfig
+}
+
+// newOutputPlugin is the single place output plugin kinds are resolved
+// to a concrete io.Writer, so adding a new --output-<kind> flag means
+// adding one case here.
+func newOutputPlugin(cfg OutputPluginConfig) io.Writer {
+	switch cfg.Kind {
+	case "http":
+		return NewHTTPOutput(cfg.Address, cfg.HTTP)
+	case "fastcgi":
+		return NewFastCGIOutput(cfg.Address, cfg.FastCGI)
+	default:
+		return nil
+	}
+}
+
+// NewPlugins builds an InOutPlugins from a set of configured outputs,
+// registering each with All alongside Outputs so plugins implementing
+// io.Closer still get shut down on exit.
+func NewPlugins(outputConfigs ...OutputPluginConfig) *InOutPlugins {
+	plugins := new(InOutPlugins)
+	for _, cfg := range outputConfigs {
+		output := newOutputPlugin(cfg)
+		if output == nil {
+			continue
+		}
+		plugins.Outputs = append(plugins.Outputs, output)
+		plugins.All = append(plugins.All, output)
+	}
+	return plugins
+}
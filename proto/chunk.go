@@ -0,0 +1,96 @@
+package proto
+
+import (
+	"bytes"
+	"errors"
+)
+
+var (
+	errEmptyChunkSize    = errors.New("proto: empty chunk size")
+	errInvalidChunkSize  = errors.New("proto: invalid chunk size")
+	errChunkSizeOverflow = errors.New("proto: chunk size overflows int64")
+	// ErrTruncatedChunk is returned by ChunkIter when body ends before a
+	// chunk it already announced the size of (or before a size line is
+	// even complete). Capture truncated mid-stream, most likely because
+	// the client aborted the upload or the capture's expiry fired early.
+	// Callers replaying the body over the wire must treat this as fatal
+	// rather than sending a chunk with no way to terminate it.
+	ErrTruncatedChunk = errors.New("proto: truncated chunked body")
+)
+
+// Chunk is one piece yielded by ChunkIter. Data holds a chunk's payload;
+// Trailers is nil until the terminating zero-length chunk, at which
+// point it holds the raw "Name: value\r\n" trailer lines declared by the
+// request/response's Trailer header, if any.
+type Chunk struct {
+	Data     []byte
+	Trailers []byte
+}
+
+// ChunkIter walks a chunked-encoded body and calls fn once per chunk in
+// the order they appear on the wire. Chunk data and trailers are handed
+// to fn as subslices of body and never copied, but body itself must
+// already hold the whole captured message. Iteration stops
+// at the first error fn returns, once the terminating zero-length chunk
+// has been delivered, or once body runs out before a complete chunk --
+// the latter also being reported as ErrTruncatedChunk, since a capture
+// that simply stops right after a chunk's data, without the terminating
+// zero-length chunk ever arriving, is truncated just as much as one that
+// stops mid-chunk.
+func ChunkIter(body []byte, fn func(Chunk) error) error {
+	for len(body) > 0 {
+		lineEnd := bytes.IndexByte(body, '\n')
+		if lineEnd < 0 {
+			return ErrTruncatedChunk
+		}
+		sizeLine := bytes.TrimSuffix(body[:lineEnd], []byte("\r"))
+		if semi := bytes.IndexByte(sizeLine, ';'); semi >= 0 {
+			sizeLine = sizeLine[:semi]
+		}
+		size, err := parseHexSize(bytes.TrimSpace(sizeLine))
+		if err != nil {
+			return err
+		}
+		body = body[lineEnd+1:]
+
+		if size == 0 {
+			return fn(Chunk{Trailers: body})
+		}
+		if int64(len(body)) < size {
+			return ErrTruncatedChunk
+		}
+
+		if err := fn(Chunk{Data: body[:size]}); err != nil {
+			return err
+		}
+		body = body[size:]
+		if len(body) >= 2 && body[0] == '\r' && body[1] == '\n' {
+			body = body[2:]
+		}
+	}
+	return ErrTruncatedChunk
+}
+
+func parseHexSize(b []byte) (int64, error) {
+	if len(b) == 0 {
+		return 0, errEmptyChunkSize
+	}
+	if len(b) > 15 {
+		return 0, errChunkSizeOverflow
+	}
+	var n int64
+	for _, c := range b {
+		n <<= 4
+		switch {
+		case c >= '0' && c <= '9':
+			n |= int64(c - '0')
+		case c >= 'a' && c <= 'f':
+			n |= int64(c-'a') + 10
+		case c >= 'A' && c <= 'F':
+			n |= int64(c-'A') + 10
+		default:
+			return 0, errInvalidChunkSize
+		}
+	}
+	return n, nil
+}
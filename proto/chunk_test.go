@@ -0,0 +1,80 @@
+package proto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+func TestChunkIter(t *testing.T) {
+	body := []byte("4\r\nWiki\r\n5\r\npedia\r\n0\r\nX-Trailer: done\r\n\r\n")
+
+	var chunks [][]byte
+	var trailers []byte
+	if err := ChunkIter(body, func(c Chunk) error {
+		if c.Trailers != nil {
+			trailers = c.Trailers
+			return nil
+		}
+		chunks = append(chunks, c.Data)
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(chunks) != 2 || !bytes.Equal(chunks[0], []byte("Wiki")) || !bytes.Equal(chunks[1], []byte("pedia")) {
+		t.Errorf("want [Wiki pedia], got %q", chunks)
+	}
+	if !bytes.Contains(trailers, []byte("X-Trailer: done")) {
+		t.Errorf("want trailers to contain X-Trailer, got %q", trailers)
+	}
+}
+
+func TestChunkIterTruncatedBody(t *testing.T) {
+	// Declares a 10-byte chunk but only 4 bytes follow: a capture cut
+	// short mid-upload. ChunkIter must report this as an error instead
+	// of silently handing the caller a partial chunk it could mistake
+	// for a complete one.
+	body := []byte("a\r\nWiki")
+
+	called := false
+	err := ChunkIter(body, func(c Chunk) error {
+		called = true
+		return nil
+	})
+
+	if !errors.Is(err, ErrTruncatedChunk) {
+		t.Errorf("want ErrTruncatedChunk, got %v", err)
+	}
+	if called {
+		t.Error("want fn not called for a truncated chunk")
+	}
+}
+
+func TestChunkIterMissingTerminator(t *testing.T) {
+	// A complete chunk arrives, but the body ends right there: the
+	// terminating zero-length chunk never shows up. ChunkIter must not
+	// mistake this for a clean end of a complete message.
+	body := []byte("4\r\nWiki\r\n")
+
+	called := false
+	err := ChunkIter(body, func(c Chunk) error {
+		called = true
+		return nil
+	})
+
+	if !errors.Is(err, ErrTruncatedChunk) {
+		t.Errorf("want ErrTruncatedChunk, got %v", err)
+	}
+	if !called {
+		t.Error("want fn called for the one complete chunk before truncation")
+	}
+}
+
+func TestChunkIterTruncatedSizeLine(t *testing.T) {
+	body := []byte("4")
+
+	if err := ChunkIter(body, func(Chunk) error { return nil }); !errors.Is(err, ErrTruncatedChunk) {
+		t.Errorf("want ErrTruncatedChunk, got %v", err)
+	}
+}
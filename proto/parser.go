@@ -0,0 +1,116 @@
+package proto
+
+import (
+	"bytes"
+	"sync"
+)
+
+// headerIndex locates a single header's name and value within a
+// message's raw byte slice, computed once per message instead of being
+// re-scanned on every Header/SetHeader call.
+type headerIndex struct {
+	nameStart, nameEnd   int
+	valueStart, valueEnd int
+}
+
+// RequestParser is a pooled, reusable view over one captured HTTP
+// message: the raw payload plus a header index built in a single pass,
+// modeled on fasthttp's approach to keep header lookups allocation-free
+// after the initial index. A lookup scans the index linearly; it does
+// not re-parse the payload. Acquire one with
+// AcquireRequest and return it with ReleaseRequest once done; the
+// returned byte slices from Header alias payload directly and stay
+// valid after Release.
+//
+// The start line is skipped rather than parsed, so the same type indexes
+// both a request ("GET / HTTP/1.1") and a response ("HTTP/1.1 200 OK")
+// payload identically — there's no separate ResponseParser.
+type RequestParser struct {
+	raw     []byte
+	headers []headerIndex
+	bodyAt  int
+}
+
+var requestParserPool = sync.Pool{
+	New: func() interface{} { return &RequestParser{headers: make([]headerIndex, 0, 16)} },
+}
+
+// AcquireRequest returns a RequestParser from the pool with payload
+// already indexed.
+func AcquireRequest(payload []byte) *RequestParser {
+	p := requestParserPool.Get().(*RequestParser)
+	p.raw = payload
+	p.headers = p.headers[:0]
+	p.bodyAt = indexHeaders(payload, &p.headers)
+	return p
+}
+
+// ReleaseRequest returns p to the pool. Callers must not retain p, or any
+// slice derived from p.raw's own backing array beyond payload itself,
+// after calling ReleaseRequest.
+func ReleaseRequest(p *RequestParser) {
+	p.raw = nil
+	requestParserPool.Put(p)
+}
+
+// Header returns the value of the first header matching name, or nil.
+func (p *RequestParser) Header(name []byte) []byte {
+	return lookupHeader(p.raw, p.headers, name)
+}
+
+// Body returns the raw bytes following the header block.
+func (p *RequestParser) Body() []byte {
+	return p.raw[p.bodyAt:]
+}
+
+func lookupHeader(raw []byte, headers []headerIndex, name []byte) []byte {
+	for _, h := range headers {
+		if bytes.EqualFold(raw[h.nameStart:h.nameEnd], name) {
+			return raw[h.valueStart:h.valueEnd]
+		}
+	}
+	return nil
+}
+
+// indexHeaders walks the start-line and header lines of raw in a single
+// pass, appending a headerIndex per "Name: value" line to out, and
+// returns the offset where the body starts (right after the blank line,
+// or len(raw) if none was found).
+func indexHeaders(raw []byte, out *[]headerIndex) int {
+	pos := bytes.IndexByte(raw, '\n')
+	if pos < 0 {
+		return len(raw)
+	}
+	pos++
+
+	for pos < len(raw) {
+		lineEnd := bytes.IndexByte(raw[pos:], '\n')
+		if lineEnd < 0 {
+			return len(raw)
+		}
+		line := raw[pos : pos+lineEnd]
+		trimmed := bytes.TrimSuffix(line, []byte("\r"))
+		lineStart := pos
+		pos += lineEnd + 1
+
+		if len(trimmed) == 0 {
+			return pos
+		}
+
+		colon := bytes.IndexByte(trimmed, ':')
+		if colon < 0 {
+			continue
+		}
+		valStart := lineStart + colon + 1
+		for valStart < lineStart+len(trimmed) && raw[valStart] == ' ' {
+			valStart++
+		}
+		*out = append(*out, headerIndex{
+			nameStart:  lineStart,
+			nameEnd:    lineStart + colon,
+			valueStart: valStart,
+			valueEnd:   lineStart + len(trimmed),
+		})
+	}
+	return len(raw)
+}
@@ -0,0 +1,67 @@
+package proto
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+var testRequestPayload = []byte("GET /ab?c=1 HTTP/1.1\r\nHost: example.com\r\nX-Real-IP: 1.2.3.4\r\n\r\nbody")
+
+func TestHeader(t *testing.T) {
+	if v := Header(testRequestPayload, []byte("X-Real-IP")); string(v) != "1.2.3.4" {
+		t.Errorf("want 1.2.3.4, got %q", v)
+	}
+	if v := Header(testRequestPayload, []byte("host")); string(v) != "example.com" {
+		t.Errorf("want example.com, got %q", v)
+	}
+	if v := Header(testRequestPayload, []byte("Missing")); v != nil {
+		t.Errorf("want nil, got %q", v)
+	}
+}
+
+func TestSetHeader(t *testing.T) {
+	payload := append([]byte{}, testRequestPayload...)
+
+	out := SetHeader(payload, []byte("Host"), []byte("other.com"))
+	if v := Header(out, []byte("Host")); string(v) != "other.com" {
+		t.Errorf("want other.com, got %q", v)
+	}
+
+	out = SetHeader(out, []byte("X-New"), []byte("v"))
+	if v := Header(out, []byte("X-New")); string(v) != "v" {
+		t.Errorf("want v, got %q", v)
+	}
+}
+
+func TestBodyChunked(t *testing.T) {
+	payload := []byte("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n4\r\nWiki\r\n5\r\npedia\r\n0\r\n\r\n")
+	got, err := Body(payload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, []byte("Wikipedia")) {
+		t.Errorf("want Wikipedia, got %q", got)
+	}
+}
+
+func TestBodyChunkedTruncated(t *testing.T) {
+	// The terminating "0\r\n\r\n" chunk never arrives: a capture cut short
+	// mid-upload. Body must report this rather than silently returning
+	// the partial data it managed to decode.
+	payload := []byte("POST / HTTP/1.1\r\nTransfer-Encoding: chunked\r\n\r\n4\r\nWiki\r\n")
+	if _, err := Body(payload); !errors.Is(err, ErrTruncatedChunk) {
+		t.Errorf("want ErrTruncatedChunk, got %v", err)
+	}
+}
+
+func TestAcquireReleaseAllocs(t *testing.T) {
+	allocs := testing.AllocsPerRun(1000, func() {
+		p := AcquireRequest(testRequestPayload)
+		p.Header([]byte("X-Real-IP"))
+		ReleaseRequest(p)
+	})
+	if allocs != 0 {
+		t.Errorf("want 0 allocs per AcquireRequest/Header/ReleaseRequest, got %v", allocs)
+	}
+}
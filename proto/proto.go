@@ -0,0 +1,97 @@
+// Package proto provides allocation-light helpers for reading and
+// rewriting captured HTTP request/response payloads in place, built on
+// top of the pooled RequestParser header index.
+package proto
+
+import (
+	"bytes"
+)
+
+// Header returns the value of header name in payload. The returned slice
+// aliases payload and stays valid after the call returns.
+func Header(payload []byte, name []byte) []byte {
+	p := AcquireRequest(payload)
+	v := p.Header(name)
+	ReleaseRequest(p)
+	return v
+}
+
+// SetHeader sets header name to value in payload, replacing the header's
+// value in place when the encoded line doesn't change length and
+// otherwise returning a newly allocated payload. If the header isn't
+// present, it's appended right after the start line.
+func SetHeader(payload []byte, name, value []byte) []byte {
+	p := AcquireRequest(payload)
+	for _, h := range p.headers {
+		if bytes.EqualFold(p.raw[h.nameStart:h.nameEnd], name) {
+			start, end := h.valueStart, h.valueEnd
+			ReleaseRequest(p)
+			return replaceSlice(payload, start, end, value)
+		}
+	}
+	ReleaseRequest(p)
+	return addHeader(payload, name, value)
+}
+
+// Body returns payload's body, decoding a chunked Transfer-Encoding into
+// a single contiguous buffer when present. It returns ErrTruncatedChunk
+// if payload declares chunked encoding but its body was captured
+// incomplete, rather than silently handing back a partial body.
+func Body(payload []byte) ([]byte, error) {
+	p := AcquireRequest(payload)
+	body := p.Body()
+	chunked := bytes.EqualFold(p.Header([]byte("Transfer-Encoding")), []byte("chunked"))
+	ReleaseRequest(p)
+
+	if !chunked {
+		return body, nil
+	}
+	return decodeChunked(body)
+}
+
+func replaceSlice(payload []byte, start, end int, value []byte) []byte {
+	if end-start == len(value) {
+		copy(payload[start:end], value)
+		return payload
+	}
+
+	out := make([]byte, 0, len(payload)-(end-start)+len(value))
+	out = append(out, payload[:start]...)
+	out = append(out, value...)
+	out = append(out, payload[end:]...)
+	return out
+}
+
+func addHeader(payload []byte, name, value []byte) []byte {
+	pos := bytes.IndexByte(payload, '\n')
+	if pos < 0 {
+		return payload
+	}
+	pos++
+
+	out := make([]byte, 0, len(payload)+len(name)+len(value)+4)
+	out = append(out, payload[:pos]...)
+	out = append(out, name...)
+	out = append(out, ':', ' ')
+	out = append(out, value...)
+	out = append(out, '\r', '\n')
+	out = append(out, payload[pos:]...)
+	return out
+}
+
+// decodeChunked walks a chunked-encoded body and returns the
+// concatenated chunk data, or ChunkIter's error if body was truncated
+// before its terminating "0\r\n" chunk ever arrived.
+func decodeChunked(body []byte) ([]byte, error) {
+	var data []byte
+	err := ChunkIter(body, func(c Chunk) error {
+		if c.Trailers == nil {
+			data = append(data, c.Data...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return data, nil
+}
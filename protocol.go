@@ -0,0 +1,9 @@
+package main
+
+// ProtocolFastCGI reassembles FastCGI records (as emitted by nginx
+// talking to php-fpm or another fcgi worker) into one logical message per
+// requestId: BEGIN_REQUEST+PARAMS+STDIN on the request side and
+// STDOUT+STDERR+END_REQUEST on the response side. See RAWInputConfig's
+// protocol field and fcgiAssembler for how it's reassembled, and
+// FastCGIOutput for how it's replayed.
+const ProtocolFastCGI Protocol = 2